@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// attemptTimeout bounds a single connection attempt
+const attemptTimeout = 5 * time.Second
+
+// connect opens and pings the database, swapped out in tests to count attempts
+var connect = sqlx.ConnectContext
+
+// Config controls how the initial database connection is retried and how the
+// connection pool is sized
+type Config struct {
+	Attempts int
+	Backoff  time.Duration
+	// Timeout bounds the whole startup wait, however many attempts are left
+	Timeout time.Duration
+
+	MaxConns        int
+	MaxIdleConns    int
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+}
+
+// ConfigFromEnv reads the connection settings from the environment. Anything
+// unset keeps its default: 5 attempts starting at a 500ms delay within 30s,
+// and the database/sql pool defaults (unlimited open conns, 2 idle, no lifetimes).
+// The idle default is lowered to DB_MAX_CONNS when that is smaller.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Attempts:     5,
+		Backoff:      500 * time.Millisecond,
+		Timeout:      30 * time.Second,
+		MaxIdleConns: 2,
+	}
+
+	var err error
+	if cfg.Attempts, err = envInt("DB_CONNECT_ATTEMPTS", cfg.Attempts); err != nil {
+		return cfg, err
+	}
+	if cfg.Backoff, err = envDuration("DB_CONNECT_BACKOFF", cfg.Backoff); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout, err = envDuration("DB_CONNECT_TIMEOUT", cfg.Timeout); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxConns, err = envInt("DB_MAX_CONNS", cfg.MaxConns); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxIdleConns, err = envInt("DB_MAX_IDLE_CONNS", cfg.MaxIdleConns); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxConnLifetime, err = envDuration("DB_MAX_CONN_LIFETIME", cfg.MaxConnLifetime); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxConnIdleTime, err = envDuration("DB_MAX_CONN_IDLE_TIME", cfg.MaxConnIdleTime); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Attempts < 1 {
+		return cfg, fmt.Errorf("DB_CONNECT_ATTEMPTS must be at least 1")
+	}
+	if cfg.Timeout <= 0 {
+		return cfg, fmt.Errorf("DB_CONNECT_TIMEOUT must be positive")
+	}
+	if cfg.MaxConns > 0 && cfg.MaxIdleConns > cfg.MaxConns {
+		if os.Getenv("DB_MAX_IDLE_CONNS") != "" {
+			return cfg, fmt.Errorf("DB_MAX_IDLE_CONNS (%d) is larger than DB_MAX_CONNS (%d)", cfg.MaxIdleConns, cfg.MaxConns)
+		}
+		cfg.MaxIdleConns = cfg.MaxConns
+	}
+	return cfg, nil
+}
+
+func envInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number, got %q", key, v)
+	}
+	return n, nil
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative duration, got %q", key, v)
+	}
+	return d, nil
+}
+
+// applyPool sizes the pool
+func (cfg Config) applyPool(db *sqlx.DB) {
+	db.SetMaxOpenConns(cfg.MaxConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.MaxConnLifetime)
+	db.SetConnMaxIdleTime(cfg.MaxConnIdleTime)
+}
+
+// Connect retries the initial connection with exponential backoff, since the
+// database may still be starting when the container comes up
+func Connect(ctx context.Context, dsn string, cfg Config) (*sqlx.DB, error) {
+	delay := cfg.Backoff
+
+	var err error
+	for i := 1; i <= cfg.Attempts; i++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		var db *sqlx.DB
+		db, err = connect(attemptCtx, "postgres", dsn)
+		cancel()
+		if err == nil {
+			cfg.applyPool(db)
+			log.Printf("database connected: max_conns=%d max_idle_conns=%d max_conn_lifetime=%s max_conn_idle_time=%s",
+				cfg.MaxConns, cfg.MaxIdleConns, cfg.MaxConnLifetime, cfg.MaxConnIdleTime)
+			return db, nil
+		}
+		log.Printf("database connection attempt %d/%d failed: %v", i, cfg.Attempts, err)
+		if i == cfg.Attempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w, last error: %w", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return nil, fmt.Errorf("database unreachable after %d attempts: %w", cfg.Attempts, err)
+}
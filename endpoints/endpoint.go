@@ -8,8 +8,10 @@ import (
 func AttachRoutes(app *echo.Echo, h *handler.Handler) {
 	app.GET("/", func(c echo.Context) error {
 		token, _ := c.Cookie("token")
+		refresh, _ := c.Cookie("refresh_token")
 
-		if token != nil {
+		// An expired token can still be refreshed from the dashboard
+		if (token != nil && token.Value != "") || (refresh != nil && refresh.Value != "") {
 			return c.Redirect(302, "/dash")
 		}
 
@@ -24,8 +26,13 @@ func AttachRoutes(app *echo.Echo, h *handler.Handler) {
 	auth := app.Group("/auth")
 	auth.GET("/", h.HandleAuth)
 	auth.GET("/redirect", h.HandleAuthCallback)
+	auth.POST("/logout", h.HandleLogout)
 
 	dashboard := app.Group("/dash")
 	dashboard.GET("", h.HandleDashboard)
 	dashboard.GET("/inventories", h.HandleInventories)
+	dashboard.GET("/inventories/:discordId", h.HandleInventoryDetail)
+
+	api := app.Group("/api")
+	api.GET("/roles", h.HandleRoles)
 }
@@ -0,0 +1,67 @@
+package endpoints
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/McCune1224/betrayal-web/handler"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMain(m *testing.M) {
+	// Templates are loaded relative to the repo root
+	if err := os.Chdir(".."); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+func newTestApp() *echo.Echo {
+	app := echo.New()
+	app.Renderer = handler.NewTemplates()
+	AttachRoutes(app, &handler.Handler{})
+	return app
+}
+
+func TestEmptyRefreshCookieDoesNotLoop(t *testing.T) {
+	app := newTestApp()
+	empty := &http.Cookie{Name: "refresh_token", Value: ""}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(empty)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected / to render the login page, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/dash", nil)
+	req.AddCookie(empty)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/" {
+		t.Fatalf("expected a 302 to /, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Value != "" || cookie.MaxAge >= 0 {
+			t.Errorf("expected %s to be cleared, got %v", cookie.Name, cookie)
+		}
+	}
+	if len(rec.Result().Cookies()) != 2 {
+		t.Errorf("expected both token cookies to be cleared, got %v", rec.Result().Cookies())
+	}
+}
+
+func TestIndexRedirectsWithRefreshToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refresh"})
+	rec := httptest.NewRecorder()
+	newTestApp().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/dash" {
+		t.Errorf("expected a 302 to /dash, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
@@ -1,9 +1,16 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/bwmarrin/discordgo"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/oauth2"
@@ -27,23 +34,175 @@ func (h *Handler) HandleAuthCallback(c echo.Context) error {
 		return c.JSON(500, err.Error())
 	}
 
-	c.SetCookie(&http.Cookie{
-		Name:    "token",
-		Value:   token.AccessToken,
-		Expires: token.Expiry,
-		Path:    "/",
-		Secure:  true,
-	})
-	c.SetCookie(&http.Cookie{
-		Name:   "refresh_token",
-		Value:  token.RefreshToken,
-		Path:   "/",
-		Secure: true,
-	})
+	setTokenCookies(c, token)
 	// Send to dashboard
 	return c.Redirect(302, "/dash")
 }
 
+func (h *Handler) HandleLogout(c echo.Context) error {
+	if !sameOrigin(c.Request()) {
+		return renderError(c, 403, "Logout must be requested from this site.", nil)
+	}
+
+	if cookie, err := c.Cookie("token"); err == nil && cookie.Value != "" {
+		// Best effort, the cookies are cleared either way
+		if err := revokeToken(c.Request().Context(), cookie.Value); err != nil {
+			c.Logger().Warn("failed to revoke discord token: ", err)
+		}
+	}
+
+	clearTokenCookies(c)
+	return c.Redirect(302, "/")
+}
+
+// sameOrigin reports whether a browser request came from this site, using the
+// Origin header when present and Sec-Fetch-Site otherwise
+func sameOrigin(r *http.Request) bool {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	}
+	site := r.Header.Get("Sec-Fetch-Site")
+	return site == "" || site == "same-origin" || site == "none"
+}
+
+var (
+	discordRevokeURL = "https://discord.com/api/oauth2/token/revoke"
+	// revokeClient keeps a slow Discord from stalling logout
+	revokeClient = &http.Client{Timeout: 5 * time.Second}
+)
+
+// revokeToken invalidates the access token with Discord
+func revokeToken(ctx context.Context, accessToken string) error {
+	form := url.Values{
+		"token":           {accessToken},
+		"token_type_hint": {"access_token"},
+		"client_id":       {os.Getenv("DISCORD_CLIENT_ID")},
+		"client_secret":   {os.Getenv("DISCORD_CLIENT_SECRET")},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discordRevokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := revokeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revoke returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// userToken returns the Discord token stored in the request cookies. Once the
+// access token cookie has expired the refresh token is used to fetch a new one,
+// and the cookies are updated. If no usable token is left the cookies are cleared.
+func (h *Handler) userToken(c echo.Context) (*oauth2.Token, error) {
+	if cookie, err := c.Cookie("token"); err == nil && cookie.Value != "" {
+		return &oauth2.Token{AccessToken: cookie.Value}, nil
+	}
+	return h.refreshUserToken(c)
+}
+
+// refreshUserToken fetches a new token with the refresh_token cookie and
+// updates the cookies, clearing them if there is nothing to refresh with or the
+// refresh fails
+func (h *Handler) refreshUserToken(c echo.Context) (*oauth2.Token, error) {
+	refresh, err := c.Cookie("refresh_token")
+	if err != nil || refresh.Value == "" {
+		// Drop any empty leftovers so / doesn't bounce the browser back here
+		clearTokenCookies(c)
+		return nil, errors.New("no token found")
+	}
+
+	expired := &oauth2.Token{
+		RefreshToken: refresh.Value,
+		Expiry:       time.Now().Add(-time.Minute),
+	}
+	token, err := refreshToken(h.tokenSource(c.Request().Context(), expired))
+	if err != nil {
+		clearTokenCookies(c)
+		return nil, err
+	}
+
+	setTokenCookies(c, token)
+	return token, nil
+}
+
+// refreshToken pulls a new token from the given source, which will use the
+// refresh token when the current token is expired.
+func refreshToken(ts oauth2.TokenSource) (*oauth2.Token, error) {
+	token, err := ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("refreshed token has no access token")
+	}
+	return token, nil
+}
+
+// ProfileFetcher looks up the Discord user an access token belongs to
+type ProfileFetcher func(ctx context.Context, accessToken string) (*discordgo.User, error)
+
+func fetchDiscordProfile(ctx context.Context, accessToken string) (*discordgo.User, error) {
+	disc, err := discordgo.New("Bearer " + accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return disc.User("@me", discordgo.WithContext(ctx))
+}
+
+// isUnauthorized reports whether Discord rejected the token, e.g. because it
+// was revoked or expired earlier than the cookie did
+func isUnauthorized(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusUnauthorized
+}
+
+// The token cookies are never read by scripts, and Lax keeps browsers from
+// sending them on cross-site POSTs such as a forged logout
+func setTokenCookies(c echo.Context, token *oauth2.Token) {
+	c.SetCookie(&http.Cookie{
+		Name:     "token",
+		Value:    token.AccessToken,
+		Expires:  token.Expiry,
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if token.RefreshToken != "" {
+		c.SetCookie(&http.Cookie{
+			Name:     "refresh_token",
+			Value:    token.RefreshToken,
+			Path:     "/",
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+func clearTokenCookies(c echo.Context) {
+	for _, name := range []string{"token", "refresh_token"} {
+		c.SetCookie(&http.Cookie{
+			Name:     name,
+			Value:    "",
+			Expires:  time.Unix(0, 0),
+			MaxAge:   -1,
+			Path:     "/",
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
 func NewDiscordOauth() *oauth2.Config {
 	cfg := &oauth2.Config{
 		ClientID:     os.Getenv("DISCORD_CLIENT_ID"),
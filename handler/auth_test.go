@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+)
+
+type fakeTokenSource struct {
+	token *oauth2.Token
+	err   error
+}
+
+func (f fakeTokenSource) Token() (*oauth2.Token, error) {
+	return f.token, f.err
+}
+
+// withTokenSource returns a Handler whose token refreshes come from the fake
+// source, recording the refresh token it was asked to use
+func withTokenSource(src fakeTokenSource, gotRefresh *string) *Handler {
+	return &Handler{
+		tokenSource: func(_ context.Context, token *oauth2.Token) oauth2.TokenSource {
+			*gotRefresh = token.RefreshToken
+			return src
+		},
+	}
+}
+
+func TestUserTokenRefreshesExpiredToken(t *testing.T) {
+	var gotRefresh string
+	h := withTokenSource(fakeTokenSource{token: &oauth2.Token{
+		AccessToken:  "new-access",
+		RefreshToken: "new-refresh",
+		Expiry:       time.Now().Add(time.Hour),
+	}}, &gotRefresh)
+	c, rec := newTestContext(http.MethodGet, "/dash", &http.Cookie{Name: "refresh_token", Value: "old-refresh"})
+
+	token, err := h.userToken(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "new-access" {
+		t.Errorf("expected the refreshed access token, got %q", token.AccessToken)
+	}
+	if gotRefresh != "old-refresh" {
+		t.Errorf("expected the refresh cookie to be used, got %q", gotRefresh)
+	}
+
+	cookies := responseCookies(rec)
+	for _, cookie := range cookies {
+		if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("expected %s to be HttpOnly and SameSite=Lax, got %v", cookie.Name, cookie)
+		}
+	}
+	if cookies["token"] == nil || cookies["token"].Value != "new-access" {
+		t.Errorf("expected the token cookie to be rewritten, got %v", cookies["token"])
+	}
+	if cookies["refresh_token"] == nil || cookies["refresh_token"].Value != "new-refresh" {
+		t.Errorf("expected the refresh_token cookie to be rewritten, got %v", cookies["refresh_token"])
+	}
+}
+
+func TestUserTokenClearsCookiesWhenRefreshFails(t *testing.T) {
+	var gotRefresh string
+	h := withTokenSource(fakeTokenSource{err: errors.New("invalid_grant")}, &gotRefresh)
+	c, rec := newTestContext(http.MethodGet, "/dash", &http.Cookie{Name: "refresh_token", Value: "old-refresh"})
+
+	if _, err := h.userToken(c); err == nil {
+		t.Fatal("expected an error when the refresh fails")
+	}
+
+	cookies := responseCookies(rec)
+	for _, name := range []string{"token", "refresh_token"} {
+		cookie := cookies[name]
+		if cookie == nil || cookie.Value != "" || cookie.MaxAge >= 0 {
+			t.Errorf("expected %s to be cleared, got %v", name, cookie)
+		}
+	}
+}
+
+func TestDashboardRedirectsWhenRefreshFails(t *testing.T) {
+	var gotRefresh string
+	h := withTokenSource(fakeTokenSource{err: errors.New("invalid_grant")}, &gotRefresh)
+	c, rec := newTestContext(http.MethodGet, "/dash", &http.Cookie{Name: "refresh_token", Value: "old-refresh"})
+
+	if err := h.HandleDashboard(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/" {
+		t.Errorf("expected a 302 to /, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestLogoutClearsCookiesAndRevokes(t *testing.T) {
+	var revoked string
+	discord := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		revoked = r.FormValue("token")
+	}))
+	defer discord.Close()
+	defer func(url string) { discordRevokeURL = url }(discordRevokeURL)
+	discordRevokeURL = discord.URL
+
+	c, rec := newTestContext(http.MethodPost, "/auth/logout",
+		&http.Cookie{Name: "token", Value: "access"},
+		&http.Cookie{Name: "refresh_token", Value: "refresh"},
+	)
+	if err := (&Handler{}).HandleLogout(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/" {
+		t.Errorf("expected a 302 to /, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if revoked != "access" {
+		t.Errorf("expected the access token to be revoked, got %q", revoked)
+	}
+
+	cookies := responseCookies(rec)
+	for _, name := range []string{"token", "refresh_token"} {
+		cookie := cookies[name]
+		if cookie == nil || cookie.Value != "" || cookie.MaxAge >= 0 || cookie.Path != "/" {
+			t.Errorf("expected %s to be expired, got %v", name, cookie)
+		}
+	}
+}
+
+func TestLogoutRejectsCrossSiteRequests(t *testing.T) {
+	c, rec := newTestContext(http.MethodPost, "/auth/logout", &http.Cookie{Name: "token", Value: "access"})
+	c.Request().Header.Set("Origin", "https://evil.example")
+	c.Response().Header().Set(echo.HeaderXRequestID, "req-123")
+
+	if err := (&Handler{}).HandleLogout(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "Logout must be requested from this site.") || !strings.Contains(rec.Body.String(), "req-123") {
+		t.Error("expected the error page with the message and request ID")
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("expected the cookies to be left alone")
+	}
+}
+
+var errDiscordUnauthorized = &discordgo.RESTError{
+	Response: &http.Response{StatusCode: http.StatusUnauthorized},
+}
+
+// profilesByToken fetches the Discord user for known access tokens and returns
+// Discord's 401 for any other token, recording the tokens it was called with
+func profilesByToken(users map[string]string, calls *[]string) ProfileFetcher {
+	return func(_ context.Context, accessToken string) (*discordgo.User, error) {
+		*calls = append(*calls, accessToken)
+		name, ok := users[accessToken]
+		if !ok {
+			return nil, errDiscordUnauthorized
+		}
+		return &discordgo.User{ID: "1", Username: name}, nil
+	}
+}
+
+func TestDashboardRefreshesRejectedToken(t *testing.T) {
+	var gotRefresh string
+	var calls []string
+	h := withTokenSource(fakeTokenSource{token: &oauth2.Token{
+		AccessToken:  "new-access",
+		RefreshToken: "new-refresh",
+		Expiry:       time.Now().Add(time.Hour),
+	}}, &gotRefresh)
+	h.fetchProfile = profilesByToken(map[string]string{"new-access": "alice"}, &calls)
+	c, rec := newTestContext(http.MethodGet, "/dash",
+		&http.Cookie{Name: "token", Value: "revoked"},
+		&http.Cookie{Name: "refresh_token", Value: "old-refresh"},
+	)
+
+	if err := h.HandleDashboard(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if len(calls) != 2 || calls[0] != "revoked" || calls[1] != "new-access" {
+		t.Errorf("expected the profile to be fetched again with the new token, got %v", calls)
+	}
+	if gotRefresh != "old-refresh" {
+		t.Errorf("expected the refresh cookie to be used, got %q", gotRefresh)
+	}
+	if !strings.Contains(rec.Body.String(), "alice") {
+		t.Error("expected the refreshed user's dashboard")
+	}
+	if cookie := responseCookies(rec)["token"]; cookie == nil || cookie.Value != "new-access" {
+		t.Errorf("expected the token cookie to be rewritten, got %v", cookie)
+	}
+}
+
+func TestDashboardRedirectsWhenTokenIsRejected(t *testing.T) {
+	tests := map[string]struct {
+		src     fakeTokenSource
+		cookies []*http.Cookie
+		calls   int
+	}{
+		"no refresh token": {
+			cookies: []*http.Cookie{{Name: "token", Value: "revoked"}},
+			calls:   1,
+		},
+		"refresh fails": {
+			src:     fakeTokenSource{err: errors.New("invalid_grant")},
+			cookies: []*http.Cookie{{Name: "token", Value: "revoked"}, {Name: "refresh_token", Value: "old-refresh"}},
+			calls:   1,
+		},
+		"refreshed token rejected": {
+			src:     fakeTokenSource{token: &oauth2.Token{AccessToken: "also-revoked", RefreshToken: "new-refresh"}},
+			cookies: []*http.Cookie{{Name: "token", Value: "revoked"}, {Name: "refresh_token", Value: "old-refresh"}},
+			calls:   2,
+		},
+		"only refreshes once": {
+			src:     fakeTokenSource{token: &oauth2.Token{AccessToken: "also-revoked", RefreshToken: "new-refresh"}},
+			cookies: []*http.Cookie{{Name: "refresh_token", Value: "old-refresh"}},
+			calls:   1,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var gotRefresh string
+			var calls []string
+			h := withTokenSource(tt.src, &gotRefresh)
+			h.fetchProfile = profilesByToken(nil, &calls)
+			c, rec := newTestContext(http.MethodGet, "/dash", tt.cookies...)
+
+			if err := h.HandleDashboard(c); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/" {
+				t.Errorf("expected a 302 to /, got %d %q", rec.Code, rec.Header().Get("Location"))
+			}
+			if len(calls) != tt.calls {
+				t.Errorf("expected %d profile fetches, got %v", tt.calls, calls)
+			}
+			cookies := responseCookies(rec)
+			for _, name := range []string{"token", "refresh_token"} {
+				if cookie := cookies[name]; cookie == nil || cookie.Value != "" || cookie.MaxAge >= 0 {
+					t.Errorf("expected %s to be cleared, got %v", name, cookie)
+				}
+			}
+		})
+	}
+}
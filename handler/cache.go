@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	defaultUserCacheTTL = 10 * time.Minute
+	// failedUserTTL is how long a failed lookup (e.g. a deleted account) is
+	// remembered before Discord is asked again
+	failedUserTTL = time.Minute
+)
+
+// UserFetcher looks up a Discord user by ID
+type UserFetcher func(userID string) (*discordgo.User, error)
+
+type cachedUser struct {
+	user      *discordgo.User
+	err       error
+	expiresAt time.Time
+}
+
+// UserCache is an in-memory TTL cache of Discord users, shared across requests
+// so listing many inventories doesn't hit Discord's rate limits
+type UserCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	users map[string]cachedUser
+	now   func() time.Time
+}
+
+func NewUserCache(ttl time.Duration) *UserCache {
+	return &UserCache{
+		ttl:   ttl,
+		users: make(map[string]cachedUser),
+		now:   time.Now,
+	}
+}
+
+// Get returns the cached user if it hasn't expired, otherwise it fetches the
+// user and caches the result. Failed fetches are cached for a shorter time so
+// unknown users don't hit Discord on every request.
+func (uc *UserCache) Get(userID string, fetch UserFetcher) (*discordgo.User, error) {
+	if cached, ok := uc.cached(userID); ok {
+		return cached.user, cached.err
+	}
+
+	user, err := fetch(userID)
+	ttl := uc.ttl
+	if err != nil {
+		ttl = min(uc.ttl, failedUserTTL)
+	}
+
+	uc.mu.Lock()
+	uc.users[userID] = cachedUser{user: user, err: err, expiresAt: uc.now().Add(ttl)}
+	uc.mu.Unlock()
+	return user, err
+}
+
+// cached returns the user's cache entry if there is one that hasn't expired
+func (uc *UserCache) cached(userID string) (cachedUser, bool) {
+	uc.mu.Lock()
+	cached, ok := uc.users[userID]
+	uc.mu.Unlock()
+	if !ok || !uc.now().Before(cached.expiresAt) {
+		return cachedUser{}, false
+	}
+	return cached, true
+}
+
+// userCacheTTL reads DISCORD_USER_CACHE_TTL (e.g. "5m"), falling back to the
+// default when it is unset
+func userCacheTTL() (time.Duration, error) {
+	v := os.Getenv("DISCORD_USER_CACHE_TTL")
+	if v == "" {
+		return defaultUserCacheTTL, nil
+	}
+	ttl, err := time.ParseDuration(v)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("DISCORD_USER_CACHE_TTL must be a positive duration, got %q", v)
+	}
+	return ttl, nil
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeClock is a settable clock for the cache
+type fakeClock struct {
+	current time.Time
+}
+
+func (f *fakeClock) now() time.Time {
+	return f.current
+}
+
+func (f *fakeClock) advance(d time.Duration) {
+	f.current = f.current.Add(d)
+}
+
+// newTestUserCache returns a cache on a fake clock and a fetcher counting its calls
+func newTestUserCache(ttl time.Duration, fetchErr error) (*UserCache, *fakeClock, UserFetcher, *int) {
+	clock := &fakeClock{current: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cache := NewUserCache(ttl)
+	cache.now = clock.now
+
+	calls := 0
+	fetch := func(userID string) (*discordgo.User, error) {
+		calls++
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return &discordgo.User{ID: userID}, nil
+	}
+	return cache, clock, fetch, &calls
+}
+
+func TestUserCacheSkipsFetchWithinTTL(t *testing.T) {
+	cache, clock, fetch, calls := newTestUserCache(10*time.Minute, nil)
+
+	for i := 0; i < 2; i++ {
+		user, err := cache.Get("123", fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != "123" {
+			t.Errorf("expected user 123, got %q", user.ID)
+		}
+		clock.advance(time.Minute)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 fetch within the TTL, got %d", *calls)
+	}
+
+	clock.advance(10 * time.Minute)
+	if _, err := cache.Get("123", fetch); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("expected a fetch after the TTL expired, got %d calls", *calls)
+	}
+}
+
+func TestUserCacheRemembersFailedFetches(t *testing.T) {
+	unknown := errors.New("404 Not Found: Unknown User")
+	cache, clock, fetch, calls := newTestUserCache(10*time.Minute, unknown)
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get("123", fetch); !errors.Is(err, unknown) {
+			t.Fatalf("expected the fetch error, got %v", err)
+		}
+	}
+	if *calls != 1 {
+		t.Fatalf("expected the failure to be cached, got %d calls", *calls)
+	}
+
+	clock.advance(failedUserTTL)
+	cache.Get("123", fetch)
+	if *calls != 2 {
+		t.Errorf("expected a retry after %v, got %d calls", failedUserTTL, *calls)
+	}
+}
+
+func TestUserCacheTTL(t *testing.T) {
+	t.Setenv("DISCORD_USER_CACHE_TTL", "")
+	if ttl, err := userCacheTTL(); err != nil || ttl != defaultUserCacheTTL {
+		t.Errorf("expected the default TTL, got %v, %v", ttl, err)
+	}
+
+	t.Setenv("DISCORD_USER_CACHE_TTL", "5m")
+	if ttl, err := userCacheTTL(); err != nil || ttl != 5*time.Minute {
+		t.Errorf("expected 5m, got %v, %v", ttl, err)
+	}
+}
+
+func TestUserCacheTTLInvalid(t *testing.T) {
+	for _, v := range []string{"forever", "0s", "-1m"} {
+		t.Run(v, func(t *testing.T) {
+			t.Setenv("DISCORD_USER_CACHE_TTL", v)
+			if _, err := userCacheTTL(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -1,7 +1,15 @@
 package handler
 
 import (
-	"os"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/labstack/echo/v4"
@@ -9,19 +17,27 @@ import (
 )
 
 func (h *Handler) HandleDashboard(e echo.Context) error {
-	cookie, err := e.Cookie("token")
+	token, err := h.userToken(e)
 	if err != nil {
 		return e.Redirect(302, "/")
 	}
-	disc, err := discordgo.New("Bearer " + cookie.Value)
-	if err != nil {
-		return e.JSON(500, err.Error())
-	}
-
 	// get user info
-	user, err := disc.User("@me")
+	user, err := h.fetchProfile(e.Request().Context(), token.AccessToken)
+	// A token from the cookie can be rejected before the cookie expires, so
+	// refresh it once unless it was just refreshed
+	if isUnauthorized(err) && token.RefreshToken == "" {
+		token, err = h.refreshUserToken(e)
+		if err != nil {
+			return e.Redirect(302, "/")
+		}
+		user, err = h.fetchProfile(e.Request().Context(), token.AccessToken)
+	}
+	if isUnauthorized(err) {
+		clearTokenCookies(e)
+		return e.Redirect(302, "/")
+	}
 	if err != nil {
-		return e.JSON(500, err.Error())
+		return renderError(e, 500, "Could not load your Discord profile.", err)
 	}
 
 	userAvatarURL := "https://cdn.discordapp.com/avatars/" + user.ID + "/" + user.Avatar + ".png"
@@ -44,36 +60,299 @@ type InventoryData struct {
 	User      UserWrapper
 }
 
-func (h *Handler) HandleInventories(e echo.Context) error {
-	_, err := e.Cookie("token")
-	if err != nil {
-		return e.Redirect(302, "/")
+// InventoriesPage is a single page of inventories along with what is needed to
+// render the pagination controls
+type InventoriesPage struct {
+	Inventories []InventoryData
+	Query       string
+	Page        int
+	Limit       int
+	TotalPages  int
+	PrevPage    int
+	NextPage    int
+	// Incomplete is set when a search gave up on usernames it couldn't look up in time
+	Incomplete bool
+}
+
+const (
+	defaultInventoryLimit = 20
+	maxInventoryLimit     = 100
+)
+
+// parsePagination reads the page and limit query params, falling back to the
+// defaults when they are not provided
+func parsePagination(e echo.Context) (page int, limit int, err error) {
+	page, limit = 1, defaultInventoryLimit
+	if p := e.QueryParam("page"); p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			return 0, 0, errors.New("page must be a positive number")
+		}
 	}
-	bot, err := discordgo.New("Bot " + os.Getenv("DISCORD_BOT_TOKEN"))
-	if err != nil {
-		return e.JSON(500, "Failed to create discord session"+err.Error())
+	if l := e.QueryParam("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxInventoryLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxInventoryLimit)
+		}
 	}
+	return page, limit, nil
+}
+
+// totalPages is how many pages of limit fit total, with at least one page
+func totalPages(total int, limit int) int {
+	return max(1, (total+limit-1)/limit)
+}
 
-	inventories, err := h.models.Inventories.GetAll()
+// lookupUser fetches a Discord user through the shared cache
+func (h *Handler) lookupUser(discordID string) (*discordgo.User, error) {
+	return h.users.Get(discordID, h.fetchUser)
+}
+
+// displayUser returns the Discord user to show for an inventory. A user that
+// can't be fetched (e.g. a deleted account) is shown by Discord ID instead of
+// failing the page.
+func (h *Handler) displayUser(e echo.Context, discordID string) *discordgo.User {
+	user, err := h.lookupUser(discordID)
 	if err != nil {
-		return e.JSON(500, err.Error())
+		e.Logger().Warnf("failed to fetch discord user %s: %v", discordID, err)
+		return &discordgo.User{ID: discordID, Username: discordID}
+	}
+	return user
+}
+
+const (
+	// lookupWorkers is how many Discord users a page looks up at once
+	lookupWorkers = 4
+	// defaultLookupTimeout bounds the Discord lookups for a single page
+	defaultLookupTimeout = 5 * time.Second
+)
+
+// lookupUsers fetches the Discord users on a few workers, stopping at the
+// context's deadline. Cached users are used without waiting on a worker. Users
+// that can't be fetched are logged and left out, and complete reports whether
+// every user was looked up in time.
+func (h *Handler) lookupUsers(ctx context.Context, e echo.Context, discordIDs []string) (users map[string]*discordgo.User, complete bool) {
+	// The echo context is reused once the request ends, so workers that are
+	// still waiting on Discord must not touch it
+	logger := e.Logger()
+
+	users = map[string]*discordgo.User{}
+	pending := []string{}
+	for _, discordID := range discordIDs {
+		if cached, ok := h.users.cached(discordID); ok {
+			if cached.err == nil {
+				users[discordID] = cached.user
+			}
+			continue
+		}
+		pending = append(pending, discordID)
+	}
+	if len(pending) == 0 {
+		return users, true
 	}
 
-	invDatas := make([]InventoryData, len(inventories))
+	type result struct {
+		discordID string
+		user      *discordgo.User
+	}
+	jobs := make(chan string)
+	// Buffered so workers finishing after the deadline never block
+	found := make(chan result, len(pending))
+	var wg sync.WaitGroup
+	for i := 0; i < min(lookupWorkers, len(pending)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for discordID := range jobs {
+				user, err := h.lookupUser(discordID)
+				if err != nil {
+					logger.Warnf("failed to fetch discord user %s: %v", discordID, err)
+					continue
+				}
+				found <- result{discordID, user}
+			}
+		}()
+	}
 
-	for i, inv := range inventories {
-		user, err := bot.User(inv.DiscordID)
-		if err != nil {
-			return e.JSON(500, "Failed to fetch user "+err.Error())
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	sent := 0
+send:
+	for _, discordID := range pending {
+		select {
+		case jobs <- discordID:
+			sent++
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+
+	complete = sent == len(pending)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		complete = false
+	}
+	if !complete {
+		logger.Warnf("discord lookups stopped after %d of %d users: %v", sent, len(pending), ctx.Err())
+	}
+
+	for {
+		select {
+		case r := <-found:
+			users[r.discordID] = r.user
+		default:
+			return users, complete
 		}
+	}
+}
+
+// withUsers pairs each inventory with its Discord user. Users that can't be
+// looked up before the context's deadline are shown by Discord ID.
+func (h *Handler) withUsers(ctx context.Context, e echo.Context, inventories []data.Inventory) []InventoryData {
+	discordIDs := make([]string, len(inventories))
+	for i, inv := range inventories {
+		discordIDs[i] = inv.DiscordID
+	}
+	users, _ := h.lookupUsers(ctx, e, discordIDs)
 
-    u := UserWrapper{*user, user.AvatarURL("")}
+	invDatas := make([]InventoryData, len(inventories))
+	for i, inv := range inventories {
+		user, ok := users[inv.DiscordID]
+		if !ok {
+			user = &discordgo.User{ID: inv.DiscordID, Username: inv.DiscordID}
+		}
 
 		invDatas[i] = InventoryData{
-			User:      u,
+			User:      UserWrapper{*user, user.AvatarURL("")},
 			Inventory: inv,
 		}
 	}
-	// return e.JSON(200, invDatas)
-	return e.Render(200, "inventories.html", invDatas)
+	return invDatas
+}
+
+// searchInventories returns the inventories whose Discord ID or username
+// contains the query, ignoring case, ordered by ID. Usernames are only looked
+// up for inventories whose ID didn't already match. complete is false when
+// some usernames couldn't be looked up before the context's deadline.
+func (h *Handler) searchInventories(ctx context.Context, e echo.Context, query string) (results []data.Inventory, complete bool, err error) {
+	inventories, err := h.inventories.GetAll()
+	if err != nil {
+		return nil, false, err
+	}
+
+	query = strings.ToLower(query)
+	results = []data.Inventory{}
+	unmatched := []data.Inventory{}
+	discordIDs := []string{}
+	for _, inv := range inventories {
+		if strings.Contains(strings.ToLower(inv.DiscordID), query) {
+			results = append(results, inv)
+		} else {
+			unmatched = append(unmatched, inv)
+			discordIDs = append(discordIDs, inv.DiscordID)
+		}
+	}
+
+	users, complete := h.lookupUsers(ctx, e, discordIDs)
+	for _, inv := range unmatched {
+		user, ok := users[inv.DiscordID]
+		if ok && strings.Contains(strings.ToLower(user.Username), query) {
+			results = append(results, inv)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+	return results, complete, nil
+}
+
+func (h *Handler) HandleInventories(e echo.Context) error {
+	_, err := h.userToken(e)
+	if err != nil {
+		return e.Redirect(302, "/")
+	}
+	page, limit, err := parsePagination(e)
+	if err != nil {
+		return renderError(e, 400, "Invalid page: "+err.Error(), nil)
+	}
+	query := strings.TrimSpace(e.QueryParam("q"))
+	// One deadline covers every Discord lookup for the page
+	ctx, cancel := context.WithTimeout(e.Request().Context(), h.lookupTimeout)
+	defer cancel()
+
+	var invDatas []InventoryData
+	var total int
+	complete := true
+	if query == "" {
+		total, err = h.inventories.Count()
+		if err != nil {
+			return renderError(e, 500, "Could not load inventories.", err)
+		}
+		// Past the end shows the last page rather than an empty one
+		page = min(page, totalPages(total, limit))
+
+		var inventories []data.Inventory
+		inventories, err = h.inventories.GetPage(limit, (page-1)*limit)
+		if err != nil {
+			return renderError(e, 500, "Could not load inventories.", err)
+		}
+		invDatas = h.withUsers(ctx, e, inventories)
+	} else {
+		var matches []data.Inventory
+		matches, complete, err = h.searchInventories(ctx, e, query)
+		if err != nil {
+			return renderError(e, 500, "Could not search inventories.", err)
+		}
+
+		total = len(matches)
+		page = min(page, totalPages(total, limit))
+		first := (page - 1) * limit
+		invDatas = h.withUsers(ctx, e, matches[first:min(first+limit, total)])
+	}
+
+	pageData := InventoriesPage{
+		Inventories: invDatas,
+		Query:       query,
+		Page:        page,
+		Limit:       limit,
+		TotalPages:  totalPages(total, limit),
+		Incomplete:  !complete,
+	}
+	if page > 1 {
+		pageData.PrevPage = page - 1
+	}
+	if page < pageData.TotalPages {
+		pageData.NextPage = page + 1
+	}
+
+	return e.Render(200, "inventories.html", pageData)
+}
+
+func (h *Handler) HandleInventoryDetail(e echo.Context) error {
+	_, err := h.userToken(e)
+	if err != nil {
+		return e.Redirect(302, "/")
+	}
+
+	inventory, err := h.inventories.GetByDiscordID(e.Param("discordId"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return renderError(e, 404, "No inventory found for that player.", nil)
+	}
+	if err != nil {
+		return renderError(e, 500, "Could not load inventory.", err)
+	}
+
+	user := h.displayUser(e, inventory.DiscordID)
+	invData := InventoryData{
+		User:      UserWrapper{*user, user.AvatarURL("")},
+		Inventory: *inventory,
+	}
+	return e.Render(200, "inventory.html", invData)
 }
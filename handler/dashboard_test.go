@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mccune1224/betrayal/pkg/data"
+)
+
+type fakeInventoryStore struct {
+	inventories []data.Inventory
+	err         error
+
+	pageLimit  int
+	pageOffset int
+}
+
+func (f *fakeInventoryStore) GetAll() ([]data.Inventory, error) {
+	return f.inventories, f.err
+}
+
+func (f *fakeInventoryStore) GetByDiscordID(discordID string) (*data.Inventory, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, inv := range f.inventories {
+		if inv.DiscordID == discordID {
+			return &inv, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeInventoryStore) Count() (int, error) {
+	return len(f.inventories), f.err
+}
+
+func (f *fakeInventoryStore) GetPage(limit int, offset int) ([]data.Inventory, error) {
+	f.pageLimit, f.pageOffset = limit, offset
+	first := min(offset, len(f.inventories))
+	return f.inventories[first:min(first+limit, len(f.inventories))], f.err
+}
+
+// newInventories makes count inventories with Discord IDs 1 through count
+func newInventories(count int) []data.Inventory {
+	inventories := make([]data.Inventory, count)
+	for i := range inventories {
+		inventories[i] = data.Inventory{ID: int64(i + 1), DiscordID: strconv.Itoa(i + 1)}
+	}
+	return inventories
+}
+
+// newDashboardHandler returns a Handler over the store whose Discord users
+// are named "user<id>"
+func newDashboardHandler(store *fakeInventoryStore) *Handler {
+	return &Handler{
+		inventories: store,
+		users:       NewUserCache(time.Hour),
+		fetchUser: func(userID string) (*discordgo.User, error) {
+			return &discordgo.User{ID: userID, Username: "user" + userID}, nil
+		},
+		lookupTimeout: time.Second,
+	}
+}
+
+var loggedIn = &http.Cookie{Name: "token", Value: "access"}
+
+var inventoryLink = regexp.MustCompile(`href="/dash/inventories/(\w+)"`)
+
+var cardUsername = regexp.MustCompile(`<h3[^>]*>\s*(.*?)\s*</h3>`)
+
+// renderedInventories lists the Discord IDs of the inventory cards in the page
+func renderedInventories(body string) []string {
+	ids := []string{}
+	for _, match := range inventoryLink.FindAllStringSubmatch(body, -1) {
+		ids = append(ids, match[1])
+	}
+	return ids
+}
+
+func TestInventoriesFetchesOnlyRequestedPage(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(5)}
+	c, rec := newTestContext(http.MethodGet, "/dash/inventories?page=2&limit=2", loggedIn)
+
+	if err := newDashboardHandler(store).HandleInventories(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if store.pageLimit != 2 || store.pageOffset != 2 {
+		t.Errorf("expected limit 2 offset 2, got limit %d offset %d", store.pageLimit, store.pageOffset)
+	}
+	if ids := renderedInventories(rec.Body.String()); len(ids) != 2 || ids[0] != "3" || ids[1] != "4" {
+		t.Errorf("expected inventories 3 and 4, got %v", ids)
+	}
+}
+
+func TestInventoriesClampsPagePastTheEnd(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(5)}
+	c, rec := newTestContext(http.MethodGet, "/dash/inventories?page=1000&limit=2", loggedIn)
+
+	if err := newDashboardHandler(store).HandleInventories(c); err != nil {
+		t.Fatal(err)
+	}
+	if store.pageOffset != 4 {
+		t.Errorf("expected the last page at offset 4, got %d", store.pageOffset)
+	}
+	if !strings.Contains(rec.Body.String(), "Page 3 of 3") {
+		t.Error("expected the last page to be rendered")
+	}
+}
+
+func TestInventoriesRejectsInvalidPagination(t *testing.T) {
+	for _, query := range []string{"page=0", "page=-1", "limit=101", "limit=0", "limit=abc", "page=abc"} {
+		t.Run(query, func(t *testing.T) {
+			store := &fakeInventoryStore{inventories: newInventories(5)}
+			c, rec := newTestContext(http.MethodGet, "/dash/inventories?"+query, loggedIn)
+
+			if err := newDashboardHandler(store).HandleInventories(c); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestInventoryDetail(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(3)}
+	c, rec := newTestContext(http.MethodGet, "/dash/inventories/2", loggedIn)
+	c.SetParamNames("discordId")
+	c.SetParamValues("2")
+
+	if err := newDashboardHandler(store).HandleInventoryDetail(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "user2") {
+		t.Error("expected the inventory's Discord user to be rendered")
+	}
+}
+
+func TestInventoryDetailUnknownDiscordUser(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(3)}
+	h := newDashboardHandler(store)
+	// Discord user 2 has been deleted
+	h.fetchUser = namedUsers(map[string]string{"1": "alice", "3": "carol"})
+	c, rec := newTestContext(http.MethodGet, "/dash/inventories/2", loggedIn)
+	c.SetParamNames("discordId")
+	c.SetParamValues("2")
+
+	if err := h.HandleInventoryDetail(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "404 Not Found") {
+		t.Error("expected the fetch error to stay out of the page")
+	}
+	if match := cardUsername.FindStringSubmatch(rec.Body.String()); match == nil || match[1] != "2" {
+		t.Errorf("expected the card to show Discord ID 2 as the username, got %v", match)
+	}
+}
+
+func TestInventoryDetailNotFound(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(3)}
+	c, rec := newTestContext(http.MethodGet, "/dash/inventories/404", loggedIn)
+	c.SetParamNames("discordId")
+	c.SetParamValues("404")
+
+	if err := newDashboardHandler(store).HandleInventoryDetail(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestInventoryDetailRequiresLogin(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(3)}
+	c, rec := newTestContext(http.MethodGet, "/dash/inventories/2")
+	c.SetParamNames("discordId")
+	c.SetParamValues("2")
+
+	if err := newDashboardHandler(store).HandleInventoryDetail(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/" {
+		t.Errorf("expected a 302 to /, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+// namedUsers fetches Discord users from a fixed set of usernames, failing for
+// anyone else
+func namedUsers(names map[string]string) UserFetcher {
+	return func(userID string) (*discordgo.User, error) {
+		name, ok := names[userID]
+		if !ok {
+			return nil, errors.New("404 Not Found: Unknown User")
+		}
+		return &discordgo.User{ID: userID, Username: name}, nil
+	}
+}
+
+func TestInventoriesSearchByUsername(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(3)}
+	h := newDashboardHandler(store)
+	h.fetchUser = namedUsers(map[string]string{"1": "Alice", "2": "bob", "3": "carol"})
+	c, rec := newTestContext(http.MethodGet, "/dash/inventories?q=BOB", loggedIn)
+
+	if err := h.HandleInventories(c); err != nil {
+		t.Fatal(err)
+	}
+	if ids := renderedInventories(rec.Body.String()); len(ids) != 1 || ids[0] != "2" {
+		t.Errorf("expected only inventory 2, got %v", ids)
+	}
+	if strings.Contains(rec.Body.String(), incompleteNotice) {
+		t.Error("expected no notice when every user was looked up")
+	}
+}
+
+func TestInventoriesSearchByDiscordID(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(12)}
+	c, rec := newTestContext(http.MethodGet, "/dash/inventories?q=11", loggedIn)
+
+	if err := newDashboardHandler(store).HandleInventories(c); err != nil {
+		t.Fatal(err)
+	}
+	if ids := renderedInventories(rec.Body.String()); len(ids) != 1 || ids[0] != "11" {
+		t.Errorf("expected only inventory 11, got %v", ids)
+	}
+}
+
+func TestInventoriesSearchSkipsUnknownUsers(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(3)}
+	h := newDashboardHandler(store)
+	// Discord user 1 has been deleted
+	h.fetchUser = namedUsers(map[string]string{"2": "alice", "3": "albert"})
+	c, rec := newTestContext(http.MethodGet, "/dash/inventories?q=al", loggedIn)
+
+	if err := h.HandleInventories(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ids := renderedInventories(rec.Body.String()); len(ids) != 2 || ids[0] != "2" || ids[1] != "3" {
+		t.Errorf("expected inventories 2 and 3, got %v", ids)
+	}
+}
+
+// hangingUsers answers for the named Discord users and blocks on everyone else,
+// like a rate limited request, until the test ends
+func hangingUsers(t *testing.T, names map[string]string) UserFetcher {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	return func(userID string) (*discordgo.User, error) {
+		if name, ok := names[userID]; ok {
+			return &discordgo.User{ID: userID, Username: name}, nil
+		}
+		<-release
+		return &discordgo.User{ID: userID, Username: "albert"}, nil
+	}
+}
+
+// serveInventories runs the handler, failing if it is still waiting on Discord
+// well after its lookup timeout
+func serveInventories(t *testing.T, h *Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	c, rec := newTestContext(http.MethodGet, target, loggedIn)
+
+	finished := make(chan error, 1)
+	go func() {
+		finished <- h.HandleInventories(c)
+	}()
+	select {
+	case err := <-finished:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the page to return once its lookups timed out")
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	return rec
+}
+
+const incompleteNotice = "results may be incomplete"
+
+func TestInventoriesSearchStopsWaitingOnSlowLookups(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(6)}
+	h := newDashboardHandler(store)
+	h.lookupTimeout = 50 * time.Millisecond
+	h.fetchUser = hangingUsers(t, map[string]string{"2": "alice"})
+
+	rec := serveInventories(t, h, "/dash/inventories?q=al")
+	if ids := renderedInventories(rec.Body.String()); len(ids) != 1 || ids[0] != "2" {
+		t.Errorf("expected only inventory 2, got %v", ids)
+	}
+	if !strings.Contains(rec.Body.String(), incompleteNotice) {
+		t.Error("expected the page to say the search was cut off")
+	}
+}
+
+func TestInventoriesSearchBoundsDiscordIDMatches(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(3)}
+	h := newDashboardHandler(store)
+	h.lookupTimeout = 50 * time.Millisecond
+	h.fetchUser = hangingUsers(t, nil)
+
+	rec := serveInventories(t, h, "/dash/inventories?q=1")
+	if ids := renderedInventories(rec.Body.String()); len(ids) != 1 || ids[0] != "1" {
+		t.Errorf("expected only inventory 1, got %v", ids)
+	}
+	if match := cardUsername.FindStringSubmatch(rec.Body.String()); match == nil || match[1] != "1" {
+		t.Errorf("expected the card to fall back to Discord ID 1, got %v", match)
+	}
+}
+
+func TestInventoriesPageFallsBackToDiscordIDs(t *testing.T) {
+	store := &fakeInventoryStore{inventories: newInventories(3)}
+	h := newDashboardHandler(store)
+	h.lookupTimeout = 50 * time.Millisecond
+	h.fetchUser = hangingUsers(t, map[string]string{"2": "alice"})
+
+	rec := serveInventories(t, h, "/dash/inventories")
+	usernames := []string{}
+	for _, match := range cardUsername.FindAllStringSubmatch(rec.Body.String(), -1) {
+		usernames = append(usernames, match[1])
+	}
+	if len(usernames) != 3 || usernames[0] != "1" || usernames[1] != "alice" || usernames[2] != "3" {
+		t.Errorf("expected 1, alice and 3, got %v", usernames)
+	}
+	if strings.Contains(rec.Body.String(), incompleteNotice) {
+		t.Error("expected no notice when every inventory is listed")
+	}
+}
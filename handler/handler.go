@@ -1,19 +1,34 @@
 package handler
 
 import (
+	"context"
+	"html/template"
 	"io"
 	"log"
+	"os"
 	"path/filepath"
-	"text/template"
+	"time"
 
+	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"github.com/mccune1224/betrayal/pkg/data"
+	"golang.org/x/oauth2"
 )
 
 type Handler struct {
-	models    data.Models
-	templates *EchoTemplates
+	inventories InventoryStore
+	roles       RoleStore
+	templates   *EchoTemplates
+	users       *UserCache
+	// fetchUser looks up Discord users with the bot's session
+	fetchUser UserFetcher
+	// fetchProfile looks up the logged in user with their own token
+	fetchProfile ProfileFetcher
+	// lookupTimeout bounds the Discord lookups for one inventories page
+	lookupTimeout time.Duration
+	// tokenSource refreshes expired Discord tokens
+	tokenSource func(ctx context.Context, token *oauth2.Token) oauth2.TokenSource
 }
 
 // PageData is the data that is passed to the template to render the page
@@ -23,10 +38,51 @@ type PageData struct {
 }
 
 
+// ErrorPageData is passed to the error template
+type ErrorPageData struct {
+	Status    int
+	Message   string
+	RequestID string
+}
+
+// renderError logs the real error server-side and renders the error page with a
+// user friendly message, tagged with the request ID so the two can be matched up
+func renderError(c echo.Context, status int, message string, err error) error {
+	requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+	if err != nil {
+		c.Logger().Errorf("request %s: %s: %v", requestID, message, err)
+	}
+
+	data := ErrorPageData{
+		Status:    status,
+		Message:   message,
+		RequestID: requestID,
+	}
+	return c.Render(status, "error.html", data)
+}
+
 func NewHandler(DB *sqlx.DB) *Handler {
+	models := data.NewModels(DB)
+	bot, err := discordgo.New("Bot " + os.Getenv("DISCORD_BOT_TOKEN"))
+	if err != nil {
+		log.Fatal("error creating discord session,", err)
+	}
+	ttl, err := userCacheTTL()
+	if err != nil {
+		log.Fatal("invalid discord user cache config,", err)
+	}
+
 	return &Handler{
-		models:    data.NewModels(DB),
-		templates: NewTemplates(),
+		inventories: &InventoryModel{models.Inventories},
+		roles:       &models.Roles,
+		templates:   NewTemplates(),
+		users:       NewUserCache(ttl),
+		fetchUser: func(userID string) (*discordgo.User, error) {
+			return bot.User(userID)
+		},
+		fetchProfile:  fetchDiscordProfile,
+		lookupTimeout: defaultLookupTimeout,
+		tokenSource:   NewDiscordOauth().TokenSource,
 	}
 }
 
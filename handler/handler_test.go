@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMain(m *testing.M) {
+	// Templates are loaded relative to the repo root
+	if err := os.Chdir(".."); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestContext builds an echo context for a request carrying the given cookies
+func newTestContext(method string, target string, cookies ...*http.Cookie) (echo.Context, *httptest.ResponseRecorder) {
+	app := echo.New()
+	app.Renderer = NewTemplates()
+
+	req := httptest.NewRequest(method, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	return app.NewContext(req, rec), rec
+}
+
+// responseCookies maps the cookies set on the response by name
+func responseCookies(rec *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range rec.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+func TestTemplatesEscapeUsernames(t *testing.T) {
+	invData := InventoryData{
+		User: UserWrapper{User: discordgo.User{Username: "<script>alert(1)</script>"}},
+	}
+
+	var buf bytes.Buffer
+	if err := NewTemplates().Render(&buf, "inventory.html", invData, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "<script>alert(1)") {
+		t.Error("expected the username to be escaped")
+	}
+	if !strings.Contains(buf.String(), "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Error("expected the escaped username in the output")
+	}
+}
+
+func TestRenderErrorHidesRawError(t *testing.T) {
+	store := &fakeInventoryStore{err: errors.New(`pq: relation "inventories" does not exist`)}
+	c, rec := newTestContext(http.MethodGet, "/dash/inventories", loggedIn)
+	c.Response().Header().Set(echo.HeaderXRequestID, "req-123")
+
+	if err := newDashboardHandler(store).HandleInventories(c); err != nil {
+		t.Fatal(err)
+	}
+
+	body := rec.Body.String()
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", rec.Code)
+	}
+	if strings.Contains(body, store.err.Error()) || strings.Contains(body, "pq:") {
+		t.Error("expected the raw error to stay out of the page")
+	}
+	if !strings.Contains(body, "Could not load inventories.") || !strings.Contains(body, "req-123") {
+		t.Error("expected the error page with the friendly message and request ID")
+	}
+}
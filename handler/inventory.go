@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"github.com/mccune1224/betrayal/pkg/data"
+)
+
+// InventoryStore is the inventory data the dashboard reads
+type InventoryStore interface {
+	GetAll() ([]data.Inventory, error)
+	GetByDiscordID(discordID string) (*data.Inventory, error)
+	Count() (int, error)
+	GetPage(limit int, offset int) ([]data.Inventory, error)
+}
+
+// InventoryModel adds the dashboard's paging queries to the betrayal data
+// package's model. That package lives in an external module, so the queries
+// it doesn't have are kept here.
+type InventoryModel struct {
+	data.InventoryModel
+}
+
+func (m *InventoryModel) Count() (int, error) {
+	var total int
+	err := m.DB.Get(&total, `SELECT COUNT(*) FROM inventories`)
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// GetPage returns inventories ordered by ID so pages stay stable
+func (m *InventoryModel) GetPage(limit int, offset int) ([]data.Inventory, error) {
+	query := `SELECT * FROM inventories ORDER BY id LIMIT $1 OFFSET $2`
+	var inventories []data.Inventory
+	err := m.DB.Select(&inventories, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return inventories, nil
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mccune1224/betrayal/pkg/data"
+)
+
+// testSchema is the part of the betrayal bot's schema the dashboard reads
+const testSchema = `
+CREATE TABLE roles (
+	id          bigserial PRIMARY KEY,
+	name        text NOT NULL,
+	description text NOT NULL DEFAULT '',
+	alignment   text NOT NULL DEFAULT '',
+	created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE inventories (
+	id               bigserial PRIMARY KEY,
+	discord_id       text NOT NULL UNIQUE,
+	user_pin_channel text NOT NULL DEFAULT '',
+	user_pin_message text NOT NULL DEFAULT '',
+	role_name        text NOT NULL DEFAULT '',
+	alignment        text NOT NULL DEFAULT '',
+	abilities        text[] NOT NULL DEFAULT '{}',
+	any_abilities    text[] NOT NULL DEFAULT '{}',
+	statuses         text[] NOT NULL DEFAULT '{}',
+	immunities       text[] NOT NULL DEFAULT '{}',
+	effects          text[] NOT NULL DEFAULT '{}',
+	items            text[] NOT NULL DEFAULT '{}',
+	item_limit       integer NOT NULL DEFAULT 8,
+	perks            text[] NOT NULL DEFAULT '{}',
+	is_alive         boolean NOT NULL DEFAULT true,
+	coins            bigint NOT NULL DEFAULT 0,
+	coin_bonus       real NOT NULL DEFAULT 0,
+	luck             bigint NOT NULL DEFAULT 0,
+	notes            text[] NOT NULL DEFAULT '{}',
+	created_at       timestamptz NOT NULL DEFAULT now()
+);
+`
+
+// openTestDB connects to TEST_DATABASE_URL, skipping the test when it isn't
+// set. The tables are created in a throwaway schema that is dropped after the
+// test, so it is safe to point at a shared database.
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A single connection keeps the search_path for every query
+	db.SetMaxOpenConns(1)
+
+	schema := fmt.Sprintf("betrayal_web_test_%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		if _, err := db.Exec(`DROP SCHEMA IF EXISTS ` + schema + ` CASCADE`); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	for _, query := range []string{`CREATE SCHEMA ` + schema, `SET search_path TO ` + schema, testSchema} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestInventoryModelPaging(t *testing.T) {
+	db := openTestDB(t)
+	// Inserted out of ID order so the ORDER BY is what sorts the pages
+	_, err := db.Exec(`INSERT INTO inventories (id, discord_id) VALUES
+		(4, '400'), (2, '200'), (5, '500'), (1, '100'), (3, '300')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &InventoryModel{data.NewModels(db).Inventories}
+
+	total, err := store.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 {
+		t.Errorf("expected 5 inventories, got %d", total)
+	}
+
+	tests := []struct {
+		limit, offset int
+		want          []string
+	}{
+		{limit: 2, offset: 0, want: []string{"100", "200"}},
+		{limit: 2, offset: 2, want: []string{"300", "400"}},
+		{limit: 2, offset: 4, want: []string{"500"}},
+		{limit: 2, offset: 6, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("limit %d offset %d", tt.limit, tt.offset), func(t *testing.T) {
+			inventories, err := store.GetPage(tt.limit, tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			for _, inv := range inventories {
+				ids = append(ids, inv.DiscordID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mccune1224/betrayal/pkg/data"
+)
+
+// RoleStore is the role data the roles API reads
+type RoleStore interface {
+	GetAll() ([]*data.Role, error)
+}
+
+// RoleResponse is the public view of a role in the catalog
+type RoleResponse struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Team        string `json:"team"`
+}
+
+// HandleRoles lists the role catalog, optionally filtered by team (alignment)
+// with the team query param
+func (h *Handler) HandleRoles(c echo.Context) error {
+	_, err := h.userToken(c)
+	if err != nil {
+		return c.JSON(401, "not logged in")
+	}
+
+	roles, err := h.roles.GetAll()
+	if err != nil {
+		c.Logger().Error("failed to list roles: ", err)
+		return c.JSON(500, "failed to list roles")
+	}
+
+	team := c.QueryParam("team")
+	resp := []RoleResponse{}
+	for _, role := range roles {
+		if team != "" && !strings.EqualFold(role.Alignment, team) {
+			continue
+		}
+		resp = append(resp, RoleResponse{
+			ID:          role.ID,
+			Name:        role.Name,
+			Description: role.Description,
+			Team:        role.Alignment,
+		})
+	}
+
+	sort.Slice(resp, func(i, j int) bool {
+		return resp[i].ID < resp[j].ID
+	})
+	return c.JSON(200, resp)
+}
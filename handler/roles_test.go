@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mccune1224/betrayal/pkg/data"
+)
+
+type fakeRoleStore []*data.Role
+
+func (f fakeRoleStore) GetAll() ([]*data.Role, error) {
+	return f, nil
+}
+
+var testRoles = fakeRoleStore{
+	{ID: 3, Name: "Wolf", Description: "Eats villagers", Alignment: "BAD"},
+	{ID: 1, Name: "Seer", Description: "Sees roles", Alignment: "GOOD"},
+	{ID: 2, Name: "Jester", Description: "Wants to be voted out", Alignment: "NEUTRAL"},
+	{ID: 4, Name: "Doctor", Description: "Protects a player", Alignment: "GOOD"},
+}
+
+// getRoles calls the roles API over the store and decodes the response
+func getRoles(t *testing.T, store RoleStore, target string) []RoleResponse {
+	t.Helper()
+	c, rec := newTestContext(http.MethodGet, target, loggedIn)
+
+	if err := (&Handler{roles: store}).HandleRoles(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var roles []RoleResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &roles); err != nil {
+		t.Fatal(err)
+	}
+	return roles
+}
+
+func TestRolesListsCatalogByID(t *testing.T) {
+	roles := getRoles(t, testRoles, "/api/roles")
+
+	if len(roles) != 4 {
+		t.Fatalf("expected 4 roles, got %d", len(roles))
+	}
+	for i, role := range roles {
+		if role.ID != int64(i+1) {
+			t.Errorf("expected roles ordered by ID, got %d at %d", role.ID, i)
+		}
+	}
+	if roles[2] != (RoleResponse{ID: 3, Name: "Wolf", Description: "Eats villagers", Team: "BAD"}) {
+		t.Errorf("unexpected role %+v", roles[2])
+	}
+}
+
+func TestRolesFiltersByTeam(t *testing.T) {
+	roles := getRoles(t, testRoles, "/api/roles?team=good")
+
+	if len(roles) != 2 || roles[0].Name != "Seer" || roles[1].Name != "Doctor" {
+		t.Errorf("expected Seer and Doctor, got %+v", roles)
+	}
+}
+
+func TestRolesRequiresLogin(t *testing.T) {
+	c, rec := newTestContext(http.MethodGet, "/api/roles")
+
+	if err := (&Handler{roles: testRoles}).HandleRoles(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestRolesFromDatabase(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.Exec(`INSERT INTO roles (id, name, description, alignment) VALUES
+		(3, 'Wolf', 'Eats villagers', 'BAD'),
+		(1, 'Seer', 'Sees roles', 'GOOD'),
+		(2, 'Jester', 'Wants to be voted out', 'NEUTRAL'),
+		(4, 'Doctor', 'Protects a player', 'GOOD')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	models := data.NewModels(db)
+
+	roles := getRoles(t, &models.Roles, "/api/roles")
+	if len(roles) != 4 {
+		t.Fatalf("expected 4 roles, got %+v", roles)
+	}
+	for i, role := range roles {
+		if role.ID != int64(i+1) {
+			t.Errorf("expected roles ordered by ID, got %d at %d", role.ID, i)
+		}
+	}
+	if roles[2] != (RoleResponse{ID: 3, Name: "Wolf", Description: "Eats villagers", Team: "BAD"}) {
+		t.Errorf("unexpected role %+v", roles[2])
+	}
+
+	roles = getRoles(t, &models.Roles, "/api/roles?team=good")
+	if len(roles) != 2 || roles[0].Name != "Seer" || roles[1].Name != "Doctor" {
+		t.Errorf("expected Seer and Doctor, got %+v", roles)
+	}
+}
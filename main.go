@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/McCune1224/betrayal-web/database"
 	"github.com/McCune1224/betrayal-web/endpoints"
 	"github.com/McCune1224/betrayal-web/handler"
-	"github.com/jmoiron/sqlx"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -15,14 +23,21 @@ import (
 func main() {
 	app := echo.New()
 	// Connect to DB
-	db, err := sqlx.Connect("postgres", os.Getenv("DATABASE_URL"))
+	dbConfig, err := database.ConfigFromEnv()
+	if err != nil {
+		log.Fatal("invalid database config,", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbConfig.Timeout)
+	db, err := database.Connect(ctx, os.Getenv("DATABASE_URL"), dbConfig)
+	cancel()
 	if err != nil {
 		log.Fatal("error opening database,", err)
 	}
 
+	app.Use(middleware.RequestID())
 	app.Use(middleware.LoggerWithConfig(
 		middleware.LoggerConfig{
-			Format: "${status} | ${latency_human} | ${method} | ${uri} | ${error} \n",
+			Format: "${id} | ${status} | ${latency_human} | ${method} | ${uri} | ${error} \n",
 		},
 	))
 
@@ -36,5 +51,48 @@ func main() {
 	app.Static("/static", "static")
 	endpoints.AttachRoutes(app, handler)
 
-	log.Fatal(app.Start(":" + os.Getenv("PORT")))
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- app.Start(":" + os.Getenv("PORT"))
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	if err := runUntilShutdown(app, db, quit, serverErr, 10*time.Second); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// runUntilShutdown waits for a signal, then lets in-flight requests drain
+// within the timeout before closing the DB. If the server stops on its own the
+// DB is closed and the server's error returned.
+func runUntilShutdown(app shutdowner, db io.Closer, quit <-chan os.Signal, serverErr <-chan error, timeout time.Duration) error {
+	select {
+	case err := <-serverErr:
+		if closeErr := db.Close(); closeErr != nil {
+			log.Println("error closing database,", closeErr)
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case sig := <-quit:
+		log.Println("shutting down server,", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	shutdownErr := app.Shutdown(ctx)
+	if shutdownErr != nil {
+		shutdownErr = fmt.Errorf("error shutting down server: %w", shutdownErr)
+	}
+	closeErr := db.Close()
+	if closeErr != nil {
+		closeErr = fmt.Errorf("error closing database: %w", closeErr)
+	}
+	return errors.Join(shutdownErr, closeErr)
 }
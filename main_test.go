@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// shutdownLog records the order the app and DB were shut down in
+type shutdownLog struct {
+	calls       []string
+	shutdownErr error
+}
+
+func (l *shutdownLog) Shutdown(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		l.calls = append(l.calls, "shutdown without deadline")
+		return nil
+	}
+	l.calls = append(l.calls, "shutdown")
+	return l.shutdownErr
+}
+
+func (l *shutdownLog) Close() error {
+	l.calls = append(l.calls, "close")
+	return nil
+}
+
+func TestRunUntilShutdownOnSignal(t *testing.T) {
+	rec := &shutdownLog{}
+	quit := make(chan os.Signal, 1)
+	quit <- syscall.SIGTERM
+
+	if err := runUntilShutdown(rec, rec, quit, make(chan error), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.calls) != 2 || rec.calls[0] != "shutdown" || rec.calls[1] != "close" {
+		t.Errorf("expected shutdown then close, got %v", rec.calls)
+	}
+}
+
+func TestRunUntilShutdownReportsShutdownError(t *testing.T) {
+	rec := &shutdownLog{shutdownErr: context.DeadlineExceeded}
+	quit := make(chan os.Signal, 1)
+	quit <- os.Interrupt
+
+	err := runUntilShutdown(rec, rec, quit, make(chan error), time.Second)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the shutdown error, got %v", err)
+	}
+	if len(rec.calls) != 2 || rec.calls[1] != "close" {
+		t.Errorf("expected the DB to still be closed, got %v", rec.calls)
+	}
+}
+
+func TestRunUntilShutdownClosesDBWhenServerFails(t *testing.T) {
+	rec := &shutdownLog{}
+	serverErr := make(chan error, 1)
+	serverErr <- errors.New("listen tcp :80: bind: permission denied")
+
+	if err := runUntilShutdown(rec, rec, make(chan os.Signal), serverErr, time.Second); err == nil {
+		t.Fatal("expected the server error to be returned")
+	}
+	if len(rec.calls) != 1 || rec.calls[0] != "close" {
+		t.Errorf("expected only the DB to be closed, got %v", rec.calls)
+	}
+}
+
+func TestRunUntilShutdownIgnoresServerClosed(t *testing.T) {
+	rec := &shutdownLog{}
+	serverErr := make(chan error, 1)
+	serverErr <- http.ErrServerClosed
+
+	if err := runUntilShutdown(rec, rec, make(chan os.Signal), serverErr, time.Second); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}